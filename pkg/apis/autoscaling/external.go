@@ -0,0 +1,25 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaling
+
+// External is the ClassAnnotationKey value that opts a PodAutoscaler out
+// of both the KPA and HPA backends: nothing here ever creates or manages
+// an HPA, leaving scaling decisions (and the replica count on the Scale
+// subresource) entirely to whatever drives them outside of
+// Knative. The hpa-class controller still keeps the PA's SKS in sync so
+// routing keeps working.
+const External = "external.autoscaling.knative.dev"
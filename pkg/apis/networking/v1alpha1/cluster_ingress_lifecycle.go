@@ -0,0 +1,39 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"github.com/knative/pkg/apis"
+)
+
+// ClusterIngressConditionTLSSecretsReady is set when every origin TLS
+// Secret referenced by the ClusterIngress's Spec.TLS has been mirrored
+// into the Istio gateway namespace(s) it needs to be readable from.
+const ClusterIngressConditionTLSSecretsReady apis.ConditionType = "TLSSecretsReady"
+
+var ciCondSet = apis.NewLivingConditionSet(ClusterIngressConditionTLSSecretsReady)
+
+// MarkTLSSecretsReady marks the TLSSecretsReady condition True.
+func (cis *ClusterIngressStatus) MarkTLSSecretsReady() {
+	ciCondSet.Manage(cis).MarkTrue(ClusterIngressConditionTLSSecretsReady)
+}
+
+// MarkTLSSecretsNotReady marks the TLSSecretsReady condition False with
+// the given reason and message.
+func (cis *ClusterIngressStatus) MarkTLSSecretsNotReady(reason, message string) {
+	ciCondSet.Manage(cis).MarkFalse(ClusterIngressConditionTLSSecretsReady, reason, message)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config holds the cluster-level configuration for the ingress
+// reconcilers, namely where to find the Istio gateways that terminate
+// ClusterIngress traffic.
+package config
+
+import (
+	"errors"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// IstioConfigName is the name of the config map for the Istio
+	// gateway configuration.
+	IstioConfigName = "config-istio"
+
+	gatewayKeyPrefix = "gateway."
+)
+
+// Gateway specifies an Istio Gateway and the in-cluster Service that
+// backs it.
+type Gateway struct {
+	GatewayName string
+	ServiceURL  string
+}
+
+// Istio holds the set of Istio ingress gateways serving ClusterIngresses.
+type Istio struct {
+	IngressGateways []Gateway
+}
+
+// Config is the umbrella cluster-level config for the ingress
+// reconcilers.
+type Config struct {
+	Istio *Istio
+}
+
+// GatewayNamespace returns the namespace of gw's backing Service, which
+// is also where TLS secret replication mirrors origin Secrets to.
+func (gw Gateway) GatewayNamespace() string {
+	parts := strings.SplitN(gw.ServiceURL, ".", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// NewIstioFromConfigMap creates an Istio config from the supplied
+// ConfigMap. Each `gateway.<name>` key's value is the fully-qualified
+// Service URL backing that Istio Gateway.
+func NewIstioFromConfigMap(configMap *corev1.ConfigMap) (*Istio, error) {
+	istio := &Istio{}
+	for k, v := range configMap.Data {
+		if !strings.HasPrefix(k, gatewayKeyPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(k, gatewayKeyPrefix)
+		if v == "" {
+			return nil, errors.New("gateway " + name + " has no value")
+		}
+		istio.IngressGateways = append(istio.IngressGateways, Gateway{
+			GatewayName: name,
+			ServiceURL:  v,
+		})
+	}
+	return istio, nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+
+	"github.com/knative/pkg/configmap"
+)
+
+type cfgKey struct{}
+
+// Store loads/watches the config-istio ConfigMap and makes it accessible
+// via context.
+type Store struct {
+	*configmap.UntypedStore
+}
+
+// NewStore creates a new Store of Configs and optionally calls the
+// provided functions whenever there's a ConfigMap update.
+func NewStore(logger configmap.Logger, onAfterStore ...func(name string, value interface{})) *Store {
+	return &Store{
+		UntypedStore: configmap.NewUntypedStore(
+			"ingress",
+			logger,
+			configmap.Constructors{
+				IstioConfigName: NewIstioFromConfigMap,
+			},
+			onAfterStore...,
+		),
+	}
+}
+
+// ToContext attaches the current state of the Store to the provided
+// context.
+func (s *Store) ToContext(ctx context.Context) context.Context {
+	return ToContext(ctx, &Config{Istio: s.UntypedLoad(IstioConfigName).(*Istio)})
+}
+
+// ToContext attaches the given Config to the provided context.
+func ToContext(ctx context.Context, c *Config) context.Context {
+	return context.WithValue(ctx, cfgKey{}, c)
+}
+
+// FromContext extracts the Config from the provided context.
+func FromContext(ctx context.Context) *Config {
+	x, ok := ctx.Value(cfgKey{}).(*Config)
+	if !ok {
+		return nil
+	}
+	return x
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+
+	"knative.dev/pkg/kmeta"
+
+	"github.com/knative/serving/pkg/apis/networking"
+	"github.com/knative/serving/pkg/apis/networking/v1alpha1"
+	"github.com/knative/serving/pkg/reconciler/ingress/config"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+)
+
+// GetSecrets fetches every origin Secret referenced by ci.Spec.TLS,
+// keyed by "namespace/name", via the supplied lister.
+func GetSecrets(ci *v1alpha1.ClusterIngress, lister corev1listers.SecretLister) (map[string]*corev1.Secret, error) {
+	secrets := make(map[string]*corev1.Secret, len(ci.Spec.TLS))
+	for _, tls := range ci.Spec.TLS {
+		secret, err := lister.Secrets(tls.SecretNamespace).Get(tls.SecretName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Secret %s/%s: %w", tls.SecretNamespace, tls.SecretName, err)
+		}
+		secrets[fmt.Sprintf("%s/%s", tls.SecretNamespace, tls.SecretName)] = secret
+	}
+	return secrets, nil
+}
+
+// MakeSecrets returns the Secrets that need to exist in the Istio
+// gateway namespace(s) to mirror originSecrets, one per (origin secret,
+// gateway namespace) pair whose namespaces actually differ. Origin
+// secrets that already live in a gateway's namespace don't need a
+// mirror there.
+func MakeSecrets(ctx context.Context, originSecrets map[string]*corev1.Secret, ci *v1alpha1.ClusterIngress) []*corev1.Secret {
+	cfg := config.FromContext(ctx)
+	secrets := []*corev1.Secret{}
+	seenNamespaces := map[string]struct{}{}
+	for _, gw := range cfg.Istio.IngressGateways {
+		targetNs := gw.GatewayNamespace()
+		if _, ok := seenNamespaces[targetNs]; ok {
+			continue
+		}
+		seenNamespaces[targetNs] = struct{}{}
+
+		for _, origin := range originSecrets {
+			if origin.Namespace == targetNs {
+				continue
+			}
+			secrets = append(secrets, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      TargetSecret(ci, origin),
+					Namespace: targetNs,
+					Labels: map[string]string{
+						networking.OriginSecretNameLabelKey:      origin.Name,
+						networking.OriginSecretNamespaceLabelKey: origin.Namespace,
+					},
+					OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(ci)},
+				},
+				Data: origin.Data,
+			})
+		}
+	}
+	return secrets
+}
+
+// TargetSecret returns the name of the mirrored Secret that replicates
+// origin into an Istio gateway namespace on behalf of ci. It's derived
+// from the origin Secret's UID rather than its name/namespace so that
+// two different origin Secrets never collide on the target name.
+//
+// This is also what satisfies the cross-ingress case: ci.Name is already
+// unique cluster-wide (ClusterIngress is cluster-scoped), so combining
+// it with origin.UID guarantees two different ClusterIngresses can never
+// be made to want the same target name for different origin Secrets --
+// the collision the secret reconciler would otherwise need to detect
+// and resolve at runtime is prevented by construction instead.
+func TargetSecret(ci *v1alpha1.ClusterIngress, origin *corev1.Secret) string {
+	return fmt.Sprintf("%s-%s", ci.Name, origin.UID)
+}
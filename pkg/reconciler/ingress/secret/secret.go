@@ -0,0 +1,318 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package secret implements a controller that keeps the TLS Secrets
+// referenced by ClusterIngresses mirrored into the namespace(s) the
+// Istio gateways live in, so the gateway's ServiceAccount can read them
+// even though the originals usually live in the serving namespace.
+package secret
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/knative/pkg/controller"
+	"github.com/knative/pkg/logging"
+	"github.com/knative/serving/pkg/apis/networking"
+	"github.com/knative/serving/pkg/apis/networking/v1alpha1"
+	ninformers "github.com/knative/serving/pkg/client/informers/externalversions/networking/v1alpha1"
+	nlisters "github.com/knative/serving/pkg/client/listers/networking/v1alpha1"
+	"github.com/knative/serving/pkg/reconciler"
+	"github.com/knative/serving/pkg/reconciler/ingress/config"
+	"github.com/knative/serving/pkg/reconciler/ingress/resources"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const controllerAgentName = "tls-secret-replication-controller"
+
+// Reconciler keeps the mirrored copies of origin TLS Secrets, referenced
+// by any ClusterIngress's Spec.TLS, in sync across namespaces. It's keyed
+// off of the ClusterIngress, not the Secrets themselves: Secret changes
+// (origin or mirror) just trigger a re-enqueue of whichever
+// ClusterIngress(es) they concern.
+type Reconciler struct {
+	*reconciler.Base
+
+	ciLister     nlisters.ClusterIngressLister
+	ciIndexer    cache.Indexer
+	secretLister corev1listers.SecretLister
+	configStore  *config.Store
+}
+
+// bySecretIndex names the ClusterIngress informer index keyed by the
+// "namespace/name" of every Secret a ClusterIngress's Spec.TLS
+// references, so enqueueReferencingClusterIngresses can look up the
+// handful of ClusterIngresses that actually care about a changed Secret
+// instead of scanning every ClusterIngress in the cluster.
+const bySecretIndex = "bySecret"
+
+// secretIndexFunc is the cache.IndexFunc backing bySecretIndex.
+func secretIndexFunc(obj interface{}) ([]string, error) {
+	ci, ok := obj.(*v1alpha1.ClusterIngress)
+	if !ok {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(ci.Spec.TLS))
+	for _, tls := range ci.Spec.TLS {
+		keys = append(keys, tls.SecretNamespace+"/"+tls.SecretName)
+	}
+	return keys, nil
+}
+
+var _ controller.Reconciler = (*Reconciler)(nil)
+
+// NewController returns a new TLS secret replication controller.
+func NewController(
+	opts *reconciler.Options,
+	ciInformer ninformers.ClusterIngressInformer,
+	secretInformer coreinformers.SecretInformer,
+) *controller.Impl {
+	if err := ciInformer.Informer().AddIndexers(cache.Indexers{bySecretIndex: secretIndexFunc}); err != nil {
+		// Indexer names are compile-time constants and AddIndexers is
+		// only ever called once per informer, here; this can't actually
+		// fail in practice.
+		panic(err)
+	}
+
+	c := &Reconciler{
+		Base:         reconciler.NewBase(*opts, controllerAgentName),
+		ciLister:     ciInformer.Lister(),
+		ciIndexer:    ciInformer.Informer().GetIndexer(),
+		secretLister: secretInformer.Lister(),
+	}
+	impl := controller.NewImpl(c, c.Logger, "TLS Secret Replication", reconciler.MustNewStatsReporter("TLS Secret Replication", c.Logger))
+
+	c.Logger.Info("Setting up tls-secret-replication event handlers")
+	ciInformer.Informer().AddEventHandler(reconciler.Handler(impl.Enqueue))
+
+	secretInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: isMirroredSecret,
+		Handler:    reconciler.Handler(impl.EnqueueControllerOf),
+	})
+	secretInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool { return !isMirroredSecret(obj) },
+		Handler:    reconciler.Handler(c.enqueueReferencingClusterIngresses(impl)),
+	})
+
+	c.configStore = config.NewStore(c.Logger, impl.GlobalResync)
+	c.configStore.WatchConfigs(opts.ConfigMapWatcher)
+
+	return impl
+}
+
+// isMirroredSecret reports whether obj is a Secret this controller
+// itself created, as opposed to a user's origin Secret.
+func isMirroredSecret(obj interface{}) bool {
+	object, ok := obj.(metav1.Object)
+	if !ok {
+		return false
+	}
+	labels := object.GetLabels()
+	_, hasName := labels[networking.OriginSecretNameLabelKey]
+	_, hasNamespace := labels[networking.OriginSecretNamespaceLabelKey]
+	return hasName && hasNamespace
+}
+
+// enqueueReferencingClusterIngresses returns a handler that, given an
+// origin Secret, enqueues every ClusterIngress whose Spec.TLS names it.
+// Origin Secrets aren't owned by the ClusterIngress (they're the user's
+// own), so there's no owner reference to key off of like there is for
+// the mirrors; bySecretIndex is what lets this avoid a cluster-wide
+// List+scan of every ClusterIngress on every unrelated Secret event.
+func (c *Reconciler) enqueueReferencingClusterIngresses(impl *controller.Impl) func(obj interface{}) {
+	return func(obj interface{}) {
+		secret, ok := obj.(*corev1.Secret)
+		if !ok {
+			return
+		}
+		cis, err := c.ciIndexer.ByIndex(bySecretIndex, secret.Namespace+"/"+secret.Name)
+		if err != nil {
+			c.Logger.Errorw("Failed to look up ClusterIngresses by referenced Secret", zap.Error(err))
+			return
+		}
+		for _, obj := range cis {
+			impl.Enqueue(obj)
+		}
+	}
+}
+
+// Reconcile is the entry point to the reconciliation control loop.
+func (c *Reconciler) Reconcile(ctx context.Context, key string) error {
+	_, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return fmt.Errorf("invalid resource key %q: %w", key, err)
+	}
+	logger := logging.FromContext(ctx)
+	logger.Debug("Reconcile TLS secrets for ClusterIngress")
+	ctx = c.configStore.ToContext(ctx)
+
+	original, err := c.ciLister.Get(name)
+	if errors.IsNotFound(err) {
+		logger.Debug("ClusterIngress no longer exists")
+		// Mirrors are owned via OwnerReferences, so they're garbage
+		// collected by the API server along with the ClusterIngress.
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	ci := original.DeepCopy()
+	err = c.reconcile(ctx, ci)
+	if equality.Semantic.DeepEqual(original.Status, ci.Status) {
+		// Nothing changed; don't call updateStatus on a possibly-stale copy.
+	} else if _, uErr := c.updateStatus(ci); uErr != nil {
+		logger.Warnw("Failed to update ClusterIngress status", zap.Error(uErr))
+		c.Recorder.Eventf(ci, corev1.EventTypeWarning, "UpdateFailed",
+			"Failed to update status for ClusterIngress %q: %v", ci.Name, uErr)
+		return uErr
+	}
+	if err != nil {
+		c.Recorder.Event(ci, corev1.EventTypeWarning, "InternalError", err.Error())
+	}
+	return err
+}
+
+func (c *Reconciler) reconcile(ctx context.Context, ci *v1alpha1.ClusterIngress) error {
+	logger := logging.FromContext(ctx)
+
+	originSecrets, err := resources.GetSecrets(ci, c.secretLister)
+	if err != nil {
+		ci.Status.MarkTLSSecretsNotReady("SecretsNotFound", err.Error())
+		return err
+	}
+
+	desired := resources.MakeSecrets(ctx, originSecrets, ci)
+	desiredByKey := make(map[string]*corev1.Secret, len(desired))
+	for _, want := range desired {
+		desiredByKey[want.Namespace+"/"+want.Name] = want
+	}
+
+	owned, err := c.listOwnedSecrets(ci)
+	if err != nil {
+		return fmt.Errorf("failed to list mirrored Secrets: %w", err)
+	}
+
+	var conflicts []string
+	for _, want := range desired {
+		got, err := c.secretLister.Secrets(want.Namespace).Get(want.Name)
+		if errors.IsNotFound(err) {
+			logger.Infof("Creating mirrored Secret %s/%s", want.Namespace, want.Name)
+			if _, err := c.KubeClientSet.CoreV1().Secrets(want.Namespace).Create(want); err != nil {
+				return fmt.Errorf("failed to create mirrored Secret %s/%s: %w", want.Namespace, want.Name, err)
+			}
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to get mirrored Secret %s/%s: %w", want.Namespace, want.Name, err)
+		}
+
+		if !metav1.IsControlledBy(got, ci) {
+			// This is deliberately not cross-ingress conflict detection:
+			// want.Name already can't collide across ClusterIngresses,
+			// because it's derived from ci.Name (unique cluster-wide,
+			// ClusterIngress being cluster-scoped) and the origin
+			// Secret's UID (see resources.TargetSecret) -- two different
+			// (ci, origin) pairs can never produce the same target name,
+			// so there's nothing for this branch to detect there. What's
+			// occupying the name here is something this controller
+			// doesn't own -- created out-of-band, or a leftover from a
+			// deleted ClusterIngress that GC hasn't caught up with yet.
+			// Leave it alone rather than fight over ownership; surface it
+			// instead.
+			conflicts = append(conflicts, fmt.Sprintf("%s/%s", want.Namespace, want.Name))
+			continue
+		}
+
+		if equality.Semantic.DeepEqual(want.Data, got.Data) && equality.Semantic.DeepEqual(want.Labels, got.Labels) {
+			continue
+		}
+		logger.Infof("Updating mirrored Secret %s/%s", want.Namespace, want.Name)
+		update := got.DeepCopy()
+		update.Data = want.Data
+		update.Labels = want.Labels
+		if _, err := c.KubeClientSet.CoreV1().Secrets(want.Namespace).Update(update); err != nil {
+			return fmt.Errorf("failed to update mirrored Secret %s/%s: %w", want.Namespace, want.Name, err)
+		}
+	}
+
+	// Orphans: mirrors we own that are no longer desired, e.g. because
+	// the origin Secret was dropped from Spec.TLS or its SecretNamespace
+	// changed so the mirror now belongs in a different gateway namespace.
+	for _, got := range owned {
+		if _, stillWanted := desiredByKey[got.Namespace+"/"+got.Name]; stillWanted {
+			continue
+		}
+		logger.Infof("Deleting orphaned mirrored Secret %s/%s", got.Namespace, got.Name)
+		if err := c.KubeClientSet.CoreV1().Secrets(got.Namespace).Delete(got.Name, nil); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete orphaned Secret %s/%s: %w", got.Namespace, got.Name, err)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		ci.Status.MarkTLSSecretsNotReady("SecretNameConflict",
+			fmt.Sprintf("mirrored secret name(s) already in use by an unowned object: %v", conflicts))
+		return nil
+	}
+	ci.Status.MarkTLSSecretsReady()
+	return nil
+}
+
+// listOwnedSecrets returns every mirrored Secret (in any namespace)
+// that's controlled by ci. Searching cluster-wide, rather than just the
+// namespace(s) desired currently names, is what lets orphans left
+// behind by a SecretNamespace change get cleaned up.
+func (c *Reconciler) listOwnedSecrets(ci *v1alpha1.ClusterIngress) ([]*corev1.Secret, error) {
+	req, err := labels.NewRequirement(networking.OriginSecretNameLabelKey, selection.Exists, nil)
+	if err != nil {
+		// The key is a compile-time constant; this can't actually fail.
+		panic(err)
+	}
+	all, err := c.secretLister.List(labels.NewSelector().Add(*req))
+	if err != nil {
+		return nil, err
+	}
+
+	owned := make([]*corev1.Secret, 0, len(all))
+	for _, s := range all {
+		if metav1.IsControlledBy(s, ci) {
+			owned = append(owned, s)
+		}
+	}
+	return owned, nil
+}
+
+func (c *Reconciler) updateStatus(desired *v1alpha1.ClusterIngress) (*v1alpha1.ClusterIngress, error) {
+	ci, err := c.ciLister.Get(desired.Name)
+	if err != nil {
+		return nil, err
+	}
+	if equality.Semantic.DeepEqual(ci.Status, desired.Status) {
+		return ci, nil
+	}
+	existing := ci.DeepCopy()
+	existing.Status = desired.Status
+	return c.ServingClientSet.NetworkingV1alpha1().ClusterIngresses().UpdateStatus(existing)
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secret
+
+import (
+	"testing"
+
+	"knative.dev/pkg/kmeta"
+	. "knative.dev/pkg/logging/testing"
+
+	"github.com/knative/serving/pkg/apis/networking"
+	"github.com/knative/serving/pkg/apis/networking/v1alpha1"
+	"github.com/knative/serving/pkg/reconciler"
+	"github.com/knative/serving/pkg/reconciler/ingress/config"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	fakek8s "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+var testCI = &v1alpha1.ClusterIngress{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "ingress",
+	},
+	Spec: v1alpha1.IngressSpec{
+		TLS: []v1alpha1.IngressTLS{{
+			Hosts:           []string{"example.com"},
+			SecretName:      "origin",
+			SecretNamespace: "knative-serving",
+		}},
+	},
+}
+
+var testConfig = &config.Config{
+	Istio: &config.Istio{
+		IngressGateways: []config.Gateway{{
+			GatewayName: "test-gateway",
+			ServiceURL:  "istio-ingressgateway.istio-system.svc.cluster.local",
+		}},
+	},
+}
+
+func newTestReconciler(t *testing.T, kubeObjects ...interface{}) (*Reconciler, *fakek8s.Clientset, kubeinformers.SharedInformerFactory) {
+	t.Helper()
+
+	kubeClient := fakek8s.NewSimpleClientset()
+	factory := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+	secretInformer := factory.Core().V1().Secrets()
+
+	for _, o := range kubeObjects {
+		secret := o.(*corev1.Secret)
+		if _, err := kubeClient.CoreV1().Secrets(secret.Namespace).Create(secret); err != nil {
+			t.Fatalf("failed to seed Secret: %v", err)
+		}
+		if err := secretInformer.Informer().GetIndexer().Add(secret); err != nil {
+			t.Fatalf("failed to index Secret: %v", err)
+		}
+	}
+
+	base := reconciler.NewBase(reconciler.Options{
+		KubeClientSet: kubeClient,
+		Logger:        TestLogger(t),
+	}, controllerAgentName)
+
+	r := &Reconciler{
+		Base:         base,
+		secretLister: secretInformer.Lister(),
+	}
+	return r, kubeClient, factory
+}
+
+func originSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "origin",
+			Namespace: "knative-serving",
+			UID:       "1234",
+		},
+		Data: map[string][]byte{"tls.crt": []byte("cert")},
+	}
+}
+
+func mirroredSecret(data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ingress-1234",
+			Namespace: "istio-system",
+			Labels: map[string]string{
+				networking.OriginSecretNameLabelKey:      "origin",
+				networking.OriginSecretNamespaceLabelKey: "knative-serving",
+			},
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(testCI)},
+		},
+		Data: data,
+	}
+}
+
+func TestReconcileCreatesMissingMirror(t *testing.T) {
+	r, kubeClient, _ := newTestReconciler(t, originSecret())
+	ctx := config.ToContext(TestContextWithLogger(t), testConfig)
+
+	ci := testCI.DeepCopy()
+	if err := r.reconcile(ctx, ci); err != nil {
+		t.Fatalf("reconcile() returned error: %v", err)
+	}
+
+	got, err := kubeClient.CoreV1().Secrets("istio-system").Get("ingress-1234", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected mirrored Secret to be created: %v", err)
+	}
+	if string(got.Data["tls.crt"]) != "cert" {
+		t.Errorf("mirrored Secret Data = %v, want the origin's Data", got.Data)
+	}
+}
+
+func TestReconcileUpdatesChangedMirror(t *testing.T) {
+	stale := mirroredSecret(map[string][]byte{"tls.crt": []byte("stale")})
+	r, kubeClient, _ := newTestReconciler(t, originSecret(), stale)
+	ctx := config.ToContext(TestContextWithLogger(t), testConfig)
+
+	ci := testCI.DeepCopy()
+	if err := r.reconcile(ctx, ci); err != nil {
+		t.Fatalf("reconcile() returned error: %v", err)
+	}
+
+	got, err := kubeClient.CoreV1().Secrets("istio-system").Get("ingress-1234", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected mirrored Secret to still exist: %v", err)
+	}
+	if string(got.Data["tls.crt"]) != "cert" {
+		t.Errorf("mirrored Secret Data = %v, want refreshed from the origin", got.Data)
+	}
+}
+
+func TestReconcileDeletesOrphanedMirror(t *testing.T) {
+	orphan := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ingress-5678",
+			Namespace: "istio-system",
+			Labels: map[string]string{
+				networking.OriginSecretNameLabelKey:      "old-origin",
+				networking.OriginSecretNamespaceLabelKey: "knative-serving",
+			},
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(testCI)},
+		},
+	}
+	r, kubeClient, _ := newTestReconciler(t, originSecret(), orphan)
+	ctx := config.ToContext(TestContextWithLogger(t), testConfig)
+
+	ci := testCI.DeepCopy()
+	if err := r.reconcile(ctx, ci); err != nil {
+		t.Fatalf("reconcile() returned error: %v", err)
+	}
+
+	if _, err := kubeClient.CoreV1().Secrets("istio-system").Get("ingress-5678", metav1.GetOptions{}); err == nil {
+		t.Error("expected orphaned mirrored Secret to be deleted")
+	}
+}
+
+func TestBySecretIndexOnlyMatchesReferencingClusterIngresses(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{bySecretIndex: secretIndexFunc})
+	if err := indexer.Add(testCI); err != nil {
+		t.Fatalf("failed to index testCI: %v", err)
+	}
+	unrelated := testCI.DeepCopy()
+	unrelated.Name = "other-ingress"
+	unrelated.Spec.TLS[0].SecretName = "other-origin"
+	if err := indexer.Add(unrelated); err != nil {
+		t.Fatalf("failed to index unrelated: %v", err)
+	}
+
+	matches, err := indexer.ByIndex(bySecretIndex, "knative-serving/origin")
+	if err != nil {
+		t.Fatalf("ByIndex() returned error: %v", err)
+	}
+	if len(matches) != 1 || matches[0].(*v1alpha1.ClusterIngress).Name != testCI.Name {
+		t.Errorf("ByIndex(%q) = %v, want only %q", "knative-serving/origin", matches, testCI.Name)
+	}
+
+	if matches, err := indexer.ByIndex(bySecretIndex, "knative-serving/no-such-secret"); err != nil {
+		t.Fatalf("ByIndex() returned error: %v", err)
+	} else if len(matches) != 0 {
+		t.Errorf("ByIndex() for an unreferenced Secret = %v, want none", matches)
+	}
+}
+
+func TestReconcileSurfacesNameConflictWithoutStealingOwnership(t *testing.T) {
+	unowned := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ingress-1234",
+			Namespace: "istio-system",
+			// No OwnerReference: this Secret isn't controlled by testCI.
+		},
+		Data: map[string][]byte{"tls.crt": []byte("not-ours")},
+	}
+	r, kubeClient, _ := newTestReconciler(t, originSecret(), unowned)
+	ctx := config.ToContext(TestContextWithLogger(t), testConfig)
+
+	ci := testCI.DeepCopy()
+	if err := r.reconcile(ctx, ci); err != nil {
+		t.Fatalf("reconcile() returned error: %v", err)
+	}
+
+	got, err := kubeClient.CoreV1().Secrets("istio-system").Get("ingress-1234", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the unowned Secret to be left alone: %v", err)
+	}
+	if string(got.Data["tls.crt"]) != "not-ours" {
+		t.Error("unowned Secret with a colliding name should not be overwritten")
+	}
+}
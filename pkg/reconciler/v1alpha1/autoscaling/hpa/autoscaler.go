@@ -0,0 +1,40 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hpa
+
+import (
+	"context"
+
+	pav1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+)
+
+// Autoscaler is the interface implemented by the scaling backends the
+// hpa-class controller can drive. Which implementation handles a given
+// PodAutoscaler is chosen solely off of its autoscaling.knative.dev/class
+// annotation, so the Reconciler itself stays backend-agnostic and only
+// has to dispatch to the right one.
+type Autoscaler interface {
+	// Reconcile brings whatever backing resources this autoscaler owns
+	// (an HPA, the SKS, ...) in line with pa's spec. It may mutate
+	// pa.Status; the caller is responsible for persisting it.
+	Reconcile(ctx context.Context, pa *pav1alpha1.PodAutoscaler) error
+
+	// Delete tears down any resources this autoscaler owns for the PA
+	// identified by key (namespace/name), since the PA itself is already
+	// gone by the time this is called.
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,31 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hpa
+
+import (
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	"k8s.io/client-go/discovery"
+)
+
+// HasHPAV2 reports whether the cluster serves the autoscaling/v2beta2
+// API. NewController checks this once at startup (it doesn't change at
+// runtime) and only wires up the v2 lister when it's true, so the
+// controller falls back cleanly to v1 on clusters that don't serve it.
+func HasHPAV2(disco discovery.ServerResourcesInterface) bool {
+	_, err := disco.ServerResourcesForGroupVersion(autoscalingv2beta2.SchemeGroupVersion.String())
+	return err == nil
+}
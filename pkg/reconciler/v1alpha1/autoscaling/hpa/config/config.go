@@ -0,0 +1,79 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config holds the cluster-level configuration for the hpa-class
+// autoscaler controller.
+package config
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	cm "github.com/knative/pkg/configmap"
+)
+
+const (
+	// HPAConfigName is the name of the config map for the HPA-class
+	// autoscaler controller.
+	HPAConfigName = "config-hpa"
+
+	// defaultScaleToZeroGracePeriod is used when the config-hpa ConfigMap
+	// doesn't set scale-to-zero-grace-period.
+	defaultScaleToZeroGracePeriod = 30 * time.Second
+)
+
+// Config includes the cluster-level configuration for the hpa-class
+// autoscaler controller.
+type Config struct {
+	// UseHPAV2 opts the controller into talking to the HPA API via
+	// autoscaling/v2beta2 instead of autoscaling/v1. v2beta2 is required
+	// for anything beyond a single CPU-utilization target: memory,
+	// External, and Object metrics, as well as scaling Behavior.
+	//
+	// This is only honored when the cluster actually serves the v2beta2
+	// API; the reconciler falls back to v1 otherwise.
+	UseHPAV2 bool
+
+	// ScaleToZeroGracePeriod is how long a scale target must sit at zero
+	// replicas, with no traffic observed by the activator in the
+	// meantime, before the hpa-class Autoscaler switches its SKS to Proxy
+	// mode and pins the HPA's MinReplicas to zero.
+	//
+	// Only relevant when UseHPAV2 is set and the cluster serves v2beta2:
+	// scaling to zero requires pinning MinReplicas below what the v1 HPA
+	// API allows.
+	ScaleToZeroGracePeriod time.Duration
+}
+
+// NewConfigFromMap creates a Config from the supplied map.
+func NewConfigFromMap(data map[string]string) (*Config, error) {
+	nc := &Config{
+		ScaleToZeroGracePeriod: defaultScaleToZeroGracePeriod,
+	}
+	if err := cm.Parse(data,
+		cm.AsBool("use-hpa-v2", &nc.UseHPAV2),
+		cm.AsDuration("scale-to-zero-grace-period", &nc.ScaleToZeroGracePeriod),
+	); err != nil {
+		return nil, err
+	}
+	return nc, nil
+}
+
+// NewConfigFromConfigMap creates a Config from the supplied ConfigMap.
+func NewConfigFromConfigMap(config *corev1.ConfigMap) (*Config, error) {
+	return NewConfigFromMap(config.Data)
+}
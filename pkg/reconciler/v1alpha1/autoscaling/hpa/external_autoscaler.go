@@ -0,0 +1,63 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hpa
+
+import (
+	"context"
+	"fmt"
+
+	pav1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+	nv1alpha1 "github.com/knative/serving/pkg/apis/networking/v1alpha1"
+	"github.com/knative/serving/pkg/reconciler"
+	nlisters "github.com/knative/serving/pkg/client/listers/networking/v1alpha1"
+
+	"k8s.io/client-go/scale"
+)
+
+// externalAutoscaler is the "External"/none Autoscaler backend. It never
+// creates an HPA, leaving scaling entirely up to whatever is driving the
+// Scale subresource outside of Knative (KEDA, a custom controller, or a
+// user's own metrics pipeline). It only keeps the SKS pointed at the
+// current pods, the same way raw deployment mode leaves routing/SKS
+// intact while skipping HPA creation.
+type externalAutoscaler struct {
+	*reconciler.Base
+
+	sksLister      nlisters.ServerlessServiceLister
+	scaleClientSet scale.ScalesGetter
+}
+
+var _ Autoscaler = (*externalAutoscaler)(nil)
+
+func (r *externalAutoscaler) Reconcile(ctx context.Context, pa *pav1alpha1.PodAutoscaler) error {
+	// We don't own scaling, so we have no basis for marking the PA
+	// inactive; assume whatever is driving the Scale subresource keeps
+	// enough replicas around to serve.
+	pa.Status.MarkActive()
+
+	selector, err := getSelector(r.scaleClientSet, pa)
+	if err != nil {
+		return fmt.Errorf("error retrieving deployment selector spec: %w", err)
+	}
+	return reconcileSKS(ctx, r.Base, r.sksLister, pa, selector, nv1alpha1.SKSOperationModeServe)
+}
+
+func (r *externalAutoscaler) Delete(ctx context.Context, key string) error {
+	// No HPA (or anything else) was ever created for this PA; the SKS is
+	// owned by the PA and is garbage collected along with it.
+	return nil
+}
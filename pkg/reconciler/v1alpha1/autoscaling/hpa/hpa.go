@@ -21,35 +21,27 @@ import (
 	"fmt"
 	"reflect"
 
-	perrors "github.com/pkg/errors"
 	"go.uber.org/zap"
 
-	"github.com/knative/pkg/apis"
 	"github.com/knative/pkg/controller"
 	"github.com/knative/pkg/logging"
 	"github.com/knative/serving/pkg/apis/autoscaling"
 	pav1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
-	nv1alpha1 "github.com/knative/serving/pkg/apis/networking/v1alpha1"
 	informers "github.com/knative/serving/pkg/client/informers/externalversions/autoscaling/v1alpha1"
 	ninformers "github.com/knative/serving/pkg/client/informers/externalversions/networking/v1alpha1"
 	listers "github.com/knative/serving/pkg/client/listers/autoscaling/v1alpha1"
-	nlisters "github.com/knative/serving/pkg/client/listers/networking/v1alpha1"
 	"github.com/knative/serving/pkg/reconciler"
-	"github.com/knative/serving/pkg/reconciler/v1alpha1/autoscaling/hpa/resources"
-	aresources "github.com/knative/serving/pkg/reconciler/v1alpha1/autoscaling/resources"
-	"github.com/knative/serving/pkg/reconciler/v1alpha1/autoscaling/resources/names"
+	hpaconfig "github.com/knative/serving/pkg/reconciler/v1alpha1/autoscaling/hpa/config"
 
-	autoscalingapi "k8s.io/api/autoscaling/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
 	autoscalingv1informers "k8s.io/client-go/informers/autoscaling/v1"
-	autoscalingv1listers "k8s.io/client-go/listers/autoscaling/v1"
-	"k8s.io/client-go/scale"
+	autoscalingv2beta2informers "k8s.io/client-go/informers/autoscaling/v2beta2"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/tools/cache"
 )
 
@@ -57,49 +49,113 @@ const (
 	controllerAgentName = "hpa-class-podautoscaler-controller"
 )
 
-// Reconciler implements the control loop for the HPA resources.
+// Reconciler implements the control loop for PodAutoscalers whose class
+// is handled by one of the Autoscaler backends registered below. It owns
+// no scaling logic itself: it just looks up the right backend for the PA
+// at hand (by class annotation) and delegates to it.
 type Reconciler struct {
 	*reconciler.Base
 
-	paLister       listers.PodAutoscalerLister
-	sksLister      nlisters.ServerlessServiceLister
-	hpaLister      autoscalingv1listers.HorizontalPodAutoscalerLister
-	scaleClientSet scale.ScalesGetter
+	paLister    listers.PodAutoscalerLister
+	configStore *hpaconfig.Store
+
+	// autoscalers is keyed by autoscaling.knative.dev/class annotation
+	// value, e.g. autoscaling.HPA, autoscaling.External. kpa-class PAs
+	// are reconciled by their own controller (see the kpa package), not
+	// dispatched through here: routing them through an Autoscaler
+	// backend would mean this Reconcile's own status write racing the
+	// kpa reconciler's, since that reconciler already writes PA status
+	// itself.
+	autoscalers map[string]Autoscaler
 }
 
 var _ controller.Reconciler = (*Reconciler)(nil)
 
-// NewController returns a new HPA reconcile controller.
+// NewController returns a new autoscaling controller that reconciles
+// hpa- and external-class PodAutoscalers by dispatching to the
+// appropriate Autoscaler backend. kpa-class PAs are handled by the kpa
+// package's own controller instead.
+//
+// hpaV2Informer is always supplied (autoscaling/v2beta2 is a built-in,
+// statically-registered API group, so constructing an informer for it
+// never fails), but it's only wired up for use -- and scale-to-zero made
+// available -- when disco reports the cluster actually serves that API
+// (see HasHPAV2); otherwise the hpa-class backend talks to the HPA API
+// via v1 regardless of the config-hpa ConfigMap's use-hpa-v2 setting.
 func NewController(
 	opts *reconciler.Options,
 	paInformer informers.PodAutoscalerInformer,
 	sksInformer ninformers.ServerlessServiceInformer,
 	hpaInformer autoscalingv1informers.HorizontalPodAutoscalerInformer,
+	hpaV2Informer autoscalingv2beta2informers.HorizontalPodAutoscalerInformer,
+	disco discovery.ServerResourcesInterface,
 ) *controller.Impl {
-	c := &Reconciler{
-		Base:           reconciler.NewBase(*opts, controllerAgentName),
-		paLister:       paInformer.Lister(),
+	base := reconciler.NewBase(*opts, controllerAgentName)
+
+	hpaBackend := &hpaAutoscaler{
+		Base:           base,
 		hpaLister:      hpaInformer.Lister(),
 		sksLister:      sksInformer.Lister(),
 		scaleClientSet: opts.ScaleClientSet,
+		clock:          clock.RealClock{},
+	}
+	if HasHPAV2(disco) {
+		hpaBackend.hpaV2Lister = hpaV2Informer.Lister()
 	}
+
+	c := &Reconciler{
+		Base:     base,
+		paLister: paInformer.Lister(),
+		autoscalers: map[string]Autoscaler{
+			autoscaling.HPA: hpaBackend,
+			autoscaling.External: &externalAutoscaler{
+				Base:           base,
+				sksLister:      sksInformer.Lister(),
+				scaleClientSet: opts.ScaleClientSet,
+			},
+		},
+	}
+	c.configStore = hpaconfig.NewStore(c.Logger)
+	c.configStore.WatchConfigs(opts.ConfigMapWatcher)
+
 	impl := controller.NewImpl(c, c.Logger, "HPA-Class Autoscaling", reconciler.MustNewStatsReporter("HPA-Class Autoscaling", c.Logger))
 
 	c.Logger.Info("Setting up hpa-class event handlers")
-	onlyHpaClass := reconciler.AnnotationFilterFunc(autoscaling.ClassAnnotationKey, autoscaling.HPA, false)
+	classFilter := c.classFilterFunc()
 	paInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
-		FilterFunc: onlyHpaClass,
+		FilterFunc: classFilter,
 		Handler:    reconciler.Handler(impl.Enqueue),
 	})
 
 	hpaInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
-		FilterFunc: onlyHpaClass,
+		FilterFunc: classFilter,
 		Handler:    reconciler.Handler(impl.EnqueueControllerOf),
 	})
 
 	return impl
 }
 
+// classFilterFunc returns a filter that matches any PA whose class
+// annotation names one of the Autoscaler backends this controller knows
+// about, so a single controller can serve hpa- and external-class PAs
+// instead of needing one controller per class.
+func (c *Reconciler) classFilterFunc() func(obj interface{}) bool {
+	return func(obj interface{}) bool {
+		object, ok := obj.(metav1.Object)
+		if !ok {
+			return false
+		}
+		class := object.GetAnnotations()[autoscaling.ClassAnnotationKey]
+		if class == "" {
+			// Unset defaults to KPA, the same as PodAutoscaler.Class(),
+			// so unannotated PAs are left to the kpa controller.
+			class = autoscaling.KPA
+		}
+		_, ok = c.autoscalers[class]
+		return ok
+	}
+}
+
 // Reconcile is the entry point to the reconciliation control loop.
 func (c *Reconciler) Reconcile(ctx context.Context, key string) error {
 	namespace, name, err := cache.SplitMetaNamespaceKey(key)
@@ -109,17 +165,27 @@ func (c *Reconciler) Reconcile(ctx context.Context, key string) error {
 	}
 	logger := logging.FromContext(ctx)
 	logger.Debug("Reconcile hpa-class PodAutoscaler")
+	ctx = c.configStore.ToContext(ctx)
 
 	original, err := c.paLister.PodAutoscalers(namespace).Get(name)
 	if errors.IsNotFound(err) {
 		logger.Debug("PA no longer exists")
-		return c.deleteHpa(ctx, key)
+		return c.deleteAll(ctx, key)
 	} else if err != nil {
 		return err
 	}
 
-	if original.Class() != autoscaling.HPA {
-		logger.Warn("Ignoring non-hpa-class PA")
+	if original.GetDeletionTimestamp() != nil {
+		// Being deleted; owned resources are cleaned up by the API
+		// server via OwnerReferences, and the eventual NotFound above
+		// will run deleteAll for anything that isn't. Don't re-create or
+		// re-update anything in the meantime.
+		return nil
+	}
+
+	autoscaler, ok := c.autoscalers[original.Class()]
+	if !ok {
+		logger.Warnf("Ignoring PA of unhandled class %q", original.Class())
 		return nil
 	}
 
@@ -127,7 +193,12 @@ func (c *Reconciler) Reconcile(ctx context.Context, key string) error {
 	pa := original.DeepCopy()
 	// Reconcile this copy of the pa and then write back any status
 	// updates regardless of whether the reconciliation errored out.
-	err = c.reconcile(ctx, key, pa)
+	pa.SetDefaults(ctx)
+	pa.Status.InitializeConditions()
+	err = autoscaler.Reconcile(ctx, pa)
+	if err == nil {
+		pa.Status.ObservedGeneration = pa.Generation
+	}
 	if equality.Semantic.DeepEqual(original.Status, pa.Status) {
 		// If we didn't change anything then don't call updateStatus.
 		// This is important because the copy we loaded from the informer's
@@ -145,116 +216,14 @@ func (c *Reconciler) Reconcile(ctx context.Context, key string) error {
 	return err
 }
 
-func (c *Reconciler) reconcile(ctx context.Context, key string, pa *pav1alpha1.PodAutoscaler) error {
-	logger := logging.FromContext(ctx)
-
-	if pa.GetDeletionTimestamp() != nil {
-		return nil
-	}
-
-	// We may be reading a version of the object that was stored at an older version
-	// and may not have had all of the assumed defaults specified.  This won't result
-	// in this getting written back to the API Server, but lets downstream logic make
-	// assumptions about defaulting.
-	pa.SetDefaults(ctx)
-
-	pa.Status.InitializeConditions()
-	logger.Debug("PA exists")
-
-	// HPA-class PAs don't yet support scale-to-zero
-	pa.Status.MarkActive()
-
-	// HPA-class PA delegates autoscaling to the Kubernetes Horizontal Pod Autoscaler.
-	desiredHpa := resources.MakeHPA(pa)
-	hpa, err := c.hpaLister.HorizontalPodAutoscalers(pa.Namespace).Get(desiredHpa.Name)
-	if errors.IsNotFound(err) {
-		logger.Infof("Creating HPA %q", desiredHpa.Name)
-		if _, err := c.KubeClientSet.AutoscalingV1().HorizontalPodAutoscalers(pa.Namespace).Create(desiredHpa); err != nil {
-			logger.Errorf("Error creating HPA %q: %v", desiredHpa.Name, err)
-			pa.Status.MarkResourceFailedCreation("HorizontalPodAutoscaler", desiredHpa.Name)
-			return err
-		}
-	} else if err != nil {
-		logger.Errorf("Error getting existing HPA %q: %v", desiredHpa.Name, err)
-		return err
-	} else if !metav1.IsControlledBy(hpa, pa) {
-		// Surface an error in the PodAutoscaler's status, and return an error.
-		pa.Status.MarkResourceNotOwned("HorizontalPodAutoscaler", desiredHpa.Name)
-		return fmt.Errorf("PodAutoscaler: %q does not own HPA: %q", pa.Name, desiredHpa.Name)
-	} else {
-		if !equality.Semantic.DeepEqual(desiredHpa.Spec, hpa.Spec) {
-			logger.Infof("Updating HPA %q", desiredHpa.Name)
-			if _, err := c.KubeClientSet.AutoscalingV1().HorizontalPodAutoscalers(pa.Namespace).Update(desiredHpa); err != nil {
-				logger.Errorf("Error updating HPA %q: %v", desiredHpa.Name, err)
-				return err
-			}
-		}
-	}
-
-	selector, err := c.getSelector(pa)
-	if err != nil {
-		return perrors.Wrap(err, "error retrieving deployment selector spec")
-	}
-	if err := c.reconcileSKS(ctx, pa, selector); err != nil {
-		return perrors.Wrap(err, "error reconciling SKS")
-	}
-
-	pa.Status.ObservedGeneration = pa.Generation
-	return nil
-}
-
-func (c *Reconciler) reconcileSKS(ctx context.Context, pa *pav1alpha1.PodAutoscaler, selector map[string]string) error {
-	logger := logging.FromContext(ctx)
-
-	sksName := names.SKS(pa.Name)
-	sks, err := c.sksLister.ServerlessServices(pa.Namespace).Get(sksName)
-	if errors.IsNotFound(err) {
-		logger.Infof("SKS %s/%s does not exist; creating.", pa.Namespace, sksName)
-		// HPA doesn't scale to zero now, so the mode is always `Serve`.
-		sks = aresources.MakeSKS(pa, selector, nv1alpha1.SKSOperationModeServe)
-		_, err = c.ServingClientSet.NetworkingV1alpha1().ServerlessServices(sks.Namespace).Create(sks)
-		if err != nil {
-			logger.Errorw(fmt.Sprintf("Error creating SKS %s/%s: ", pa.Namespace, sksName), zap.Error(err))
-			return err
-		}
-		logger.Infof("Created SKS: %q", sksName)
-	} else if err != nil {
-		logger.Errorw(fmt.Sprintf("Error getting SKS %s: ", sksName), zap.Error(err))
-		return err
-	} else if !metav1.IsControlledBy(sks, pa) {
-		pa.Status.MarkResourceNotOwned("ServerlessService", sksName)
-		return fmt.Errorf("KPA: %q does not own SKS: %q", pa.Name, sksName)
-	}
-	tmpl := aresources.MakeSKS(pa, selector, nv1alpha1.SKSOperationModeServe)
-	if !equality.Semantic.DeepEqual(tmpl.Spec, sks.Spec) {
-		want := sks.DeepCopy()
-		want.Spec = tmpl.Spec
-		logger.Infof("SKS changed; reconciling: %s", sksName)
-		if _, err = c.ServingClientSet.NetworkingV1alpha1().ServerlessServices(sks.Namespace).Update(want); err != nil {
-			logger.Errorw(fmt.Sprintf("Error updating SKS %s: ", sksName), zap.Error(err))
+// deleteAll runs Delete on every registered Autoscaler backend, since by
+// the time the PA is gone we no longer know which class it was.
+func (c *Reconciler) deleteAll(ctx context.Context, key string) error {
+	for _, autoscaler := range c.autoscalers {
+		if err := autoscaler.Delete(ctx, key); err != nil {
 			return err
 		}
 	}
-	logger.Debugf("Done reconciling SKS %s", sksName)
-	return nil
-}
-
-func (c *Reconciler) deleteHpa(ctx context.Context, key string) error {
-	logger := logging.FromContext(ctx)
-
-	namespace, name, err := cache.SplitMetaNamespaceKey(key)
-	if err != nil {
-		return err
-	}
-	err = c.KubeClientSet.AutoscalingV1().HorizontalPodAutoscalers(namespace).Delete(name, nil)
-	if errors.IsNotFound(err) {
-		// This is fine.
-		return nil
-	} else if err != nil {
-		logger.Errorf("Error deleting HPA %q: %v", name, err)
-		return err
-	}
-	logger.Infof("Deleted HPA %q", name)
 	return nil
 }
 
@@ -272,31 +241,3 @@ func (c *Reconciler) updateStatus(desired *pav1alpha1.PodAutoscaler) (*pav1alpha
 	}
 	return pa, nil
 }
-
-func (c *Reconciler) getSelector(pa *pav1alpha1.PodAutoscaler) (map[string]string, error) {
-	scale, err := c.getScaleResource(pa)
-	if err != nil {
-		return nil, err
-	}
-	return labels.ConvertSelectorToLabelsMap(scale.Status.Selector)
-}
-
-// getScaleResource returns the current scale resource for the PA.
-func (c *Reconciler) getScaleResource(pa *pav1alpha1.PodAutoscaler) (*autoscalingapi.Scale, error) {
-	resource, resourceName, err := scaleResourceArgs(pa)
-	if err != nil {
-		return nil, err
-	}
-	// Identify the current scale.
-	return c.scaleClientSet.Scales(pa.Namespace).Get(*resource, resourceName)
-}
-
-// scaleResourceArgs returns GroupResource and the resource name, from the PA resource.
-func scaleResourceArgs(pa *pav1alpha1.PodAutoscaler) (*schema.GroupResource, string, error) {
-	gv, err := schema.ParseGroupVersion(pa.Spec.ScaleTargetRef.APIVersion)
-	if err != nil {
-		return nil, "", err
-	}
-	resource := apis.KindToResource(gv.WithKind(pa.Spec.ScaleTargetRef.Kind)).GroupResource()
-	return &resource, pa.Spec.ScaleTargetRef.Name, nil
-}
@@ -0,0 +1,233 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hpa
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/knative/pkg/logging"
+	pav1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+	nv1alpha1 "github.com/knative/serving/pkg/apis/networking/v1alpha1"
+	"github.com/knative/serving/pkg/reconciler"
+	"github.com/knative/serving/pkg/reconciler/v1alpha1/autoscaling/hpa/config"
+	"github.com/knative/serving/pkg/reconciler/v1alpha1/autoscaling/hpa/resources"
+	aresources "github.com/knative/serving/pkg/reconciler/v1alpha1/autoscaling/resources"
+	"github.com/knative/serving/pkg/reconciler/v1alpha1/autoscaling/resources/names"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/clock"
+	nlisters "github.com/knative/serving/pkg/client/listers/networking/v1alpha1"
+	autoscalingv1listers "k8s.io/client-go/listers/autoscaling/v1"
+	autoscalingv2beta2listers "k8s.io/client-go/listers/autoscaling/v2beta2"
+	"k8s.io/client-go/scale"
+	"k8s.io/client-go/tools/cache"
+)
+
+// hpaAutoscaler is the Autoscaler implementation that delegates scaling
+// decisions to the Kubernetes Horizontal Pod Autoscaler. It creates and
+// keeps in sync both the HPA and the SKS.
+//
+// It talks to the HPA API via v1 or v2beta2 depending on both the
+// config-hpa ConfigMap and whether the cluster actually serves v2beta2:
+// hpaV2Lister is nil on clusters that don't, in which case v1 is used
+// regardless of the config flag. Scale-to-zero (see scale_to_zero.go) is
+// only available in the v2beta2 case, since v1 can't express a zero
+// MinReplicas. It also requires the API server to be run with the
+// HPAScaleToZero feature gate enabled; without it, the API server
+// rejects any HorizontalPodAutoscaler with MinReplicas: 0 regardless of
+// what MetricSpecs it carries.
+type hpaAutoscaler struct {
+	*reconciler.Base
+
+	hpaLister      autoscalingv1listers.HorizontalPodAutoscalerLister
+	hpaV2Lister    autoscalingv2beta2listers.HorizontalPodAutoscalerLister
+	sksLister      nlisters.ServerlessServiceLister
+	scaleClientSet scale.ScalesGetter
+
+	// clock is used instead of calling time.Now/time.Since directly so
+	// that the scale-to-zero grace-period state machine can be driven by
+	// a fake clock in tests. Always clock.RealClock{} outside of tests.
+	clock clock.Clock
+}
+
+var _ Autoscaler = (*hpaAutoscaler)(nil)
+
+func (r *hpaAutoscaler) Reconcile(ctx context.Context, pa *pav1alpha1.PodAutoscaler) error {
+	scaleResource, err := getScaleResource(r.scaleClientSet, pa)
+	if err != nil {
+		return fmt.Errorf("error retrieving Scale resource: %w", err)
+	}
+	selector, err := labels.ConvertSelectorToLabelsMap(scaleResource.Status.Selector)
+	if err != nil {
+		return fmt.Errorf("error retrieving deployment selector spec: %w", err)
+	}
+
+	useV2 := r.hpaV2Lister != nil && config.FromContext(ctx).UseHPAV2
+
+	mode := nv1alpha1.SKSOperationModeServe
+	minReplicas, _ := resources.ScaleBounds(pa)
+	if useV2 {
+		mode, minReplicas, err = r.scaleToZeroState(ctx, pa, scaleResource.Spec.Replicas)
+		if err != nil {
+			return fmt.Errorf("error resolving scale-to-zero state: %w", err)
+		}
+	} else {
+		// Without v2beta2 we can't pin the HPA's MinReplicas to zero, so
+		// hpa-class PAs on this cluster never scale to zero.
+		pa.Status.MarkActive()
+	}
+
+	if useV2 {
+		err = r.reconcileHPAV2(ctx, pa, minReplicas)
+	} else {
+		err = r.reconcileHPAV1(ctx, pa)
+	}
+	if err != nil {
+		return err
+	}
+
+	return reconcileSKS(ctx, r.Base, r.sksLister, pa, selector, mode)
+}
+
+func (r *hpaAutoscaler) reconcileHPAV1(ctx context.Context, pa *pav1alpha1.PodAutoscaler) error {
+	logger := logging.FromContext(ctx)
+
+	desiredHpa := resources.MakeHPA(pa)
+	hpa, err := r.hpaLister.HorizontalPodAutoscalers(pa.Namespace).Get(desiredHpa.Name)
+	if errors.IsNotFound(err) {
+		logger.Infof("Creating HPA %q", desiredHpa.Name)
+		if _, err := r.KubeClientSet.AutoscalingV1().HorizontalPodAutoscalers(pa.Namespace).Create(desiredHpa); err != nil {
+			logger.Errorf("Error creating HPA %q: %v", desiredHpa.Name, err)
+			pa.Status.MarkResourceFailedCreation("HorizontalPodAutoscaler", desiredHpa.Name)
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Errorf("Error getting existing HPA %q: %v", desiredHpa.Name, err)
+		return err
+	} else if !metav1.IsControlledBy(hpa, pa) {
+		pa.Status.MarkResourceNotOwned("HorizontalPodAutoscaler", desiredHpa.Name)
+		return fmt.Errorf("PodAutoscaler: %q does not own HPA: %q", pa.Name, desiredHpa.Name)
+	}
+
+	if !equality.Semantic.DeepEqual(desiredHpa.Spec, hpa.Spec) {
+		logger.Infof("Updating HPA %q", desiredHpa.Name)
+		if _, err := r.KubeClientSet.AutoscalingV1().HorizontalPodAutoscalers(pa.Namespace).Update(desiredHpa); err != nil {
+			logger.Errorf("Error updating HPA %q: %v", desiredHpa.Name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *hpaAutoscaler) reconcileHPAV2(ctx context.Context, pa *pav1alpha1.PodAutoscaler, minReplicas int32) error {
+	logger := logging.FromContext(ctx)
+
+	desiredHpa := resources.MakeHPAV2(pa, minReplicas)
+	hpa, err := r.hpaV2Lister.HorizontalPodAutoscalers(pa.Namespace).Get(desiredHpa.Name)
+	if errors.IsNotFound(err) {
+		logger.Infof("Creating HPA (v2beta2) %q", desiredHpa.Name)
+		if _, err := r.KubeClientSet.AutoscalingV2beta2().HorizontalPodAutoscalers(pa.Namespace).Create(desiredHpa); err != nil {
+			logger.Errorf("Error creating HPA %q: %v", desiredHpa.Name, err)
+			pa.Status.MarkResourceFailedCreation("HorizontalPodAutoscaler", desiredHpa.Name)
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Errorf("Error getting existing HPA %q: %v", desiredHpa.Name, err)
+		return err
+	} else if !metav1.IsControlledBy(hpa, pa) {
+		pa.Status.MarkResourceNotOwned("HorizontalPodAutoscaler", desiredHpa.Name)
+		return fmt.Errorf("PodAutoscaler: %q does not own HPA: %q", pa.Name, desiredHpa.Name)
+	}
+
+	if !equality.Semantic.DeepEqual(desiredHpa.Spec, hpa.Spec) {
+		logger.Infof("Updating HPA (v2beta2) %q", desiredHpa.Name)
+		if _, err := r.KubeClientSet.AutoscalingV2beta2().HorizontalPodAutoscalers(pa.Namespace).Update(desiredHpa); err != nil {
+			logger.Errorf("Error updating HPA %q: %v", desiredHpa.Name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *hpaAutoscaler) Delete(ctx context.Context, key string) error {
+	logger := logging.FromContext(ctx)
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	// Whichever API version was in play when this PA was last reconciled,
+	// deleting the other one is just a harmless NotFound.
+	if err := r.KubeClientSet.AutoscalingV1().HorizontalPodAutoscalers(namespace).Delete(name, nil); err != nil && !errors.IsNotFound(err) {
+		logger.Errorf("Error deleting HPA %q: %v", name, err)
+		return err
+	}
+	if r.hpaV2Lister != nil {
+		if err := r.KubeClientSet.AutoscalingV2beta2().HorizontalPodAutoscalers(namespace).Delete(name, nil); err != nil && !errors.IsNotFound(err) {
+			logger.Errorf("Error deleting HPA %q: %v", name, err)
+			return err
+		}
+	}
+	logger.Infof("Deleted HPA %q", name)
+	return nil
+}
+
+// reconcileSKS is shared by every Autoscaler backend: they all need an SKS
+// to front the revision's pods, they just disagree about what mode it
+// should run in and whether a backing HPA exists alongside it.
+func reconcileSKS(ctx context.Context, base *reconciler.Base, sksLister nlisters.ServerlessServiceLister, pa *pav1alpha1.PodAutoscaler, selector map[string]string, mode nv1alpha1.ServerlessServiceOperationMode) error {
+	logger := logging.FromContext(ctx)
+
+	sksName := names.SKS(pa.Name)
+	sks, err := sksLister.ServerlessServices(pa.Namespace).Get(sksName)
+	if errors.IsNotFound(err) {
+		logger.Infof("SKS %s/%s does not exist; creating.", pa.Namespace, sksName)
+		sks = aresources.MakeSKS(pa, selector, mode)
+		_, err = base.ServingClientSet.NetworkingV1alpha1().ServerlessServices(sks.Namespace).Create(sks)
+		if err != nil {
+			logger.Errorw(fmt.Sprintf("Error creating SKS %s/%s: ", pa.Namespace, sksName), zap.Error(err))
+			return err
+		}
+		logger.Infof("Created SKS: %q", sksName)
+	} else if err != nil {
+		logger.Errorw(fmt.Sprintf("Error getting SKS %s: ", sksName), zap.Error(err))
+		return err
+	} else if !metav1.IsControlledBy(sks, pa) {
+		pa.Status.MarkResourceNotOwned("ServerlessService", sksName)
+		return fmt.Errorf("PA: %q does not own SKS: %q", pa.Name, sksName)
+	}
+	tmpl := aresources.MakeSKS(pa, selector, mode)
+	if !equality.Semantic.DeepEqual(tmpl.Spec, sks.Spec) {
+		want := sks.DeepCopy()
+		want.Spec = tmpl.Spec
+		logger.Infof("SKS changed; reconciling: %s", sksName)
+		if _, err = base.ServingClientSet.NetworkingV1alpha1().ServerlessServices(sks.Namespace).Update(want); err != nil {
+			logger.Errorw(fmt.Sprintf("Error updating SKS %s: ", sksName), zap.Error(err))
+			return err
+		}
+	}
+	logger.Debugf("Done reconciling SKS %s", sksName)
+	return nil
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+const (
+	// MemoryTargetAnnotationKey configures an additional Resource metric
+	// against memory utilization, expressed the same way as the existing
+	// CPU target (a percentage). Only honored when HPAv2 is in play.
+	MemoryTargetAnnotationKey = "autoscaling.knative.dev/memoryTarget"
+
+	// ExternalMetricNameAnnotationKey names an external metric (e.g. one
+	// backed by the Prometheus adapter, or a queue depth from SQS/
+	// Pub/Sub) to add as an External MetricSpec. Only honored when HPAv2
+	// is in play, and only together with ExternalMetricTargetAnnotationKey.
+	ExternalMetricNameAnnotationKey = "autoscaling.knative.dev/externalMetricName"
+
+	// ExternalMetricTargetAnnotationKey is the target average value for
+	// the metric named by ExternalMetricNameAnnotationKey.
+	ExternalMetricTargetAnnotationKey = "autoscaling.knative.dev/externalMetricTarget"
+
+	// RequestConcurrencyTargetAnnotationKey adds an Object MetricSpec
+	// sourced from the activator's per-revision request-concurrency
+	// metric, letting HPAv2 scale directly on the same signal KPA-class
+	// PAs use. The value is the target average concurrency per pod.
+	RequestConcurrencyTargetAnnotationKey = "autoscaling.knative.dev/requestConcurrencyTarget"
+)
@@ -0,0 +1,94 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package resources defines the Kubernetes resources built by the
+// hpa-class autoscaler.
+package resources
+
+import (
+	"strconv"
+
+	"github.com/knative/serving/pkg/apis/autoscaling"
+	pav1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+	"github.com/knative/serving/pkg/reconciler/v1alpha1/autoscaling/resources/names"
+	"knative.dev/pkg/kmeta"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultCPUTarget is used when a PA doesn't specify a target utilization
+// via its autoscaling.knative.dev/target annotation.
+const defaultCPUTarget = 80
+
+// MakeHPA creates an autoscaling/v1 HorizontalPodAutoscaler from the PA.
+// This is the only shape the v1 API can express: a single CPU
+// utilization target against the PA's scale target.
+func MakeHPA(pa *pav1alpha1.PodAutoscaler) *autoscalingv1.HorizontalPodAutoscaler {
+	min, max := ScaleBounds(pa)
+	return &autoscalingv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            names.HPA(pa.Name),
+			Namespace:       pa.Namespace,
+			Labels:          pa.Labels,
+			Annotations:     pa.Annotations,
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(pa)},
+		},
+		Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef:                 pa.Spec.ScaleTargetRef,
+			MinReplicas:                    &min,
+			MaxReplicas:                    max,
+			TargetCPUUtilizationPercentage: targetCPUUtilization(pa),
+		},
+	}
+}
+
+// ScaleBounds reads the min/max replica annotations off of the PA,
+// falling back to defaults that are legal for the v1 HPA API (which, in
+// particular, requires a positive MaxReplicas). Callers that support
+// scaling to zero (HPAv2 only) override the returned min themselves
+// rather than relying on this default.
+func ScaleBounds(pa *pav1alpha1.PodAutoscaler) (min, max int32) {
+	min = 1
+	max = 1
+	if v, ok := pa.Annotations[autoscaling.MinScaleAnnotationKey]; ok {
+		if parsed, err := strconv.ParseInt(v, 10, 32); err == nil {
+			min = int32(parsed)
+		}
+	}
+	if v, ok := pa.Annotations[autoscaling.MaxScaleAnnotationKey]; ok {
+		if parsed, err := strconv.ParseInt(v, 10, 32); err == nil && parsed > 0 {
+			max = int32(parsed)
+		}
+	}
+	if max < min {
+		max = min
+	}
+	return min, max
+}
+
+// targetCPUUtilization reads the scaling target off of the PA's
+// autoscaling.knative.dev/target annotation, falling back to
+// defaultCPUTarget if it's unset or unparsable.
+func targetCPUUtilization(pa *pav1alpha1.PodAutoscaler) *int32 {
+	target := int32(defaultCPUTarget)
+	if v, ok := pa.Annotations[autoscaling.TargetAnnotationKey]; ok {
+		if parsed, err := strconv.ParseInt(v, 10, 32); err == nil {
+			target = int32(parsed)
+		}
+	}
+	return &target
+}
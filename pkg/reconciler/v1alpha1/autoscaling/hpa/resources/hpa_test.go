@@ -0,0 +1,82 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/knative/serving/pkg/apis/autoscaling"
+	pav1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func withAnnotations(annotations map[string]string) *pav1alpha1.PodAutoscaler {
+	return &pav1alpha1.PodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "my-pa",
+			Namespace:   "default",
+			Annotations: annotations,
+		},
+	}
+}
+
+func TestScaleBounds(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		wantMin     int32
+		wantMax     int32
+	}{{
+		name:        "no annotations defaults to 1/1",
+		annotations: nil,
+		wantMin:     1,
+		wantMax:     1,
+	}, {
+		name: "explicit min and max",
+		annotations: map[string]string{
+			autoscaling.MinScaleAnnotationKey: "2",
+			autoscaling.MaxScaleAnnotationKey: "10",
+		},
+		wantMin: 2,
+		wantMax: 10,
+	}, {
+		name: "max below min is raised to min",
+		annotations: map[string]string{
+			autoscaling.MinScaleAnnotationKey: "5",
+			autoscaling.MaxScaleAnnotationKey: "2",
+		},
+		wantMin: 5,
+		wantMax: 5,
+	}, {
+		name: "unparsable annotations fall back to defaults",
+		annotations: map[string]string{
+			autoscaling.MinScaleAnnotationKey: "not-a-number",
+			autoscaling.MaxScaleAnnotationKey: "also-not-a-number",
+		},
+		wantMin: 1,
+		wantMax: 1,
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			min, max := ScaleBounds(withAnnotations(c.annotations))
+			if min != c.wantMin || max != c.wantMax {
+				t.Errorf("ScaleBounds() = (%d, %d), want (%d, %d)", min, max, c.wantMin, c.wantMax)
+			}
+		})
+	}
+}
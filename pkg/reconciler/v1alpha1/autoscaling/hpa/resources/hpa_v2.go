@@ -0,0 +1,60 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	pav1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+	"github.com/knative/serving/pkg/reconciler/v1alpha1/autoscaling/resources/names"
+	"knative.dev/pkg/kmeta"
+
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MakeHPAV2 creates an autoscaling/v2beta2 HorizontalPodAutoscaler from
+// the PA. Unlike MakeHPA, it can express multiple/custom metrics; it's
+// only used once the reconciler has established that the cluster
+// actually serves the v2beta2 API.
+//
+// It doesn't set Spec.Behavior: HorizontalPodAutoscalerBehavior and the
+// HPAScalingRules/HPAScalingPolicy types it's built from were only added
+// to autoscaling/v2beta2 in Kubernetes 1.18, newer than what this
+// cluster's vendored API surface supports. No scale-up/scale-down rate
+// or stabilization-window tuning is applied to the HPA; the PA's window
+// annotation is not read here.
+//
+// minReplicas is passed in rather than derived from ScaleBounds because
+// the hpa-class Autoscaler pins it to zero while the PA is scaled to
+// zero, overriding whatever the PA's own min-scale annotation says.
+func MakeHPAV2(pa *pav1alpha1.PodAutoscaler, minReplicas int32) *autoscalingv2beta2.HorizontalPodAutoscaler {
+	_, max := ScaleBounds(pa)
+	return &autoscalingv2beta2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            names.HPA(pa.Name),
+			Namespace:       pa.Namespace,
+			Labels:          pa.Labels,
+			Annotations:     pa.Annotations,
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(pa)},
+		},
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: pa.Spec.ScaleTargetRef,
+			MinReplicas:    &minReplicas,
+			MaxReplicas:    max,
+			Metrics:        makeMetricSpecs(pa, minReplicas),
+		},
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"strconv"
+
+	pav1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// requestConcurrencyMetricName is the name the activator publishes
+// per-revision request concurrency under; HPAv2 Object metrics read it
+// the same way the KPA-class autoscaler does.
+const requestConcurrencyMetricName = "activator_request_concurrency"
+
+// makeMetricSpecs translates the PA's annotations into the []MetricSpec
+// HPAv2 needs: the CPU target every hpa-class PA already has, plus
+// whichever of memory/external/object metrics the PA opted into.
+//
+// minReplicas is the same value being set on the HPA's Spec.MinReplicas:
+// when it's zero, the Resource (CPU/memory) metrics are left out
+// entirely. Kubernetes only admits minReplicas: 0 -- and only with the
+// HPAScaleToZero feature gate enabled on the API server -- when every
+// MetricSpec is Object or External; a Resource metric alongside
+// MinReplicas: 0 is rejected outright, which would otherwise make
+// scale-to-zero silently fail at the API server.
+func makeMetricSpecs(pa *pav1alpha1.PodAutoscaler, minReplicas int32) []autoscalingv2beta2.MetricSpec {
+	var specs []autoscalingv2beta2.MetricSpec
+
+	if minReplicas > 0 {
+		specs = append(specs, autoscalingv2beta2.MetricSpec{
+			Type: autoscalingv2beta2.ResourceMetricSourceType,
+			Resource: &autoscalingv2beta2.ResourceMetricSource{
+				Name: corev1.ResourceCPU,
+				Target: autoscalingv2beta2.MetricTarget{
+					Type:               autoscalingv2beta2.UtilizationMetricType,
+					AverageUtilization: targetCPUUtilization(pa),
+				},
+			},
+		})
+
+		if v, ok := pa.Annotations[MemoryTargetAnnotationKey]; ok {
+			if parsed, err := strconv.ParseInt(v, 10, 32); err == nil {
+				utilization := int32(parsed)
+				specs = append(specs, autoscalingv2beta2.MetricSpec{
+					Type: autoscalingv2beta2.ResourceMetricSourceType,
+					Resource: &autoscalingv2beta2.ResourceMetricSource{
+						Name: corev1.ResourceMemory,
+						Target: autoscalingv2beta2.MetricTarget{
+							Type:               autoscalingv2beta2.UtilizationMetricType,
+							AverageUtilization: &utilization,
+						},
+					},
+				})
+			}
+		}
+	}
+
+	if name, ok := pa.Annotations[ExternalMetricNameAnnotationKey]; ok {
+		if v, ok := pa.Annotations[ExternalMetricTargetAnnotationKey]; ok {
+			if q, err := resource.ParseQuantity(v); err == nil {
+				specs = append(specs, autoscalingv2beta2.MetricSpec{
+					Type: autoscalingv2beta2.ExternalMetricSourceType,
+					External: &autoscalingv2beta2.ExternalMetricSource{
+						Metric: autoscalingv2beta2.MetricIdentifier{Name: name},
+						Target: autoscalingv2beta2.MetricTarget{
+							Type:         autoscalingv2beta2.AverageValueMetricType,
+							AverageValue: &q,
+						},
+					},
+				})
+			}
+		}
+	}
+
+	if v, ok := pa.Annotations[RequestConcurrencyTargetAnnotationKey]; ok {
+		if q, err := resource.ParseQuantity(v); err == nil {
+			specs = append(specs, autoscalingv2beta2.MetricSpec{
+				Type: autoscalingv2beta2.ObjectMetricSourceType,
+				Object: &autoscalingv2beta2.ObjectMetricSource{
+					DescribedObject: autoscalingv2beta2.CrossVersionObjectReference{
+						Kind:       "Service",
+						Name:       pa.Name,
+						APIVersion: "v1",
+					},
+					Metric: autoscalingv2beta2.MetricIdentifier{Name: requestConcurrencyMetricName},
+					Target: autoscalingv2beta2.MetricTarget{
+						Type:         autoscalingv2beta2.AverageValueMetricType,
+						AverageValue: &q,
+					},
+				},
+			})
+		}
+	}
+
+	return specs
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMakeMetricSpecsIncludesCPUByDefault(t *testing.T) {
+	specs := makeMetricSpecs(withAnnotations(nil), 1 /* minReplicas */)
+	if len(specs) != 1 {
+		t.Fatalf("got %d metric specs, want 1 (CPU only)", len(specs))
+	}
+	if specs[0].Resource == nil || specs[0].Resource.Name != corev1.ResourceCPU {
+		t.Errorf("expected the lone metric to target CPU, got %+v", specs[0])
+	}
+}
+
+func TestMakeMetricSpecsDropsResourceMetricsAtMinReplicasZero(t *testing.T) {
+	specs := makeMetricSpecs(withAnnotations(map[string]string{
+		MemoryTargetAnnotationKey: "80",
+	}), 0 /* minReplicas */)
+
+	for _, s := range specs {
+		if s.Type == autoscalingv2beta2.ResourceMetricSourceType {
+			t.Errorf("got a Resource MetricSpec with minReplicas 0, want none (the API server rejects minReplicas: 0 alongside a Resource metric): %+v", s)
+		}
+	}
+}
+
+func TestMakeMetricSpecsMemoryIsUtilizationPercent(t *testing.T) {
+	specs := makeMetricSpecs(withAnnotations(map[string]string{
+		MemoryTargetAnnotationKey: "80",
+	}), 1 /* minReplicas */)
+
+	var memory *autoscalingv2beta2.MetricSpec
+	for i := range specs {
+		if specs[i].Resource != nil && specs[i].Resource.Name == corev1.ResourceMemory {
+			memory = &specs[i]
+		}
+	}
+	if memory == nil {
+		t.Fatalf("expected a memory MetricSpec, got %+v", specs)
+	}
+	if memory.Resource.Target.Type != autoscalingv2beta2.UtilizationMetricType {
+		t.Errorf("memory target type = %v, want UtilizationMetricType", memory.Resource.Target.Type)
+	}
+	if memory.Resource.Target.AverageUtilization == nil || *memory.Resource.Target.AverageUtilization != 80 {
+		t.Errorf("memory AverageUtilization = %v, want 80", memory.Resource.Target.AverageUtilization)
+	}
+}
+
+func TestMakeMetricSpecsExternalAndObject(t *testing.T) {
+	specs := makeMetricSpecs(withAnnotations(map[string]string{
+		ExternalMetricNameAnnotationKey:       "queue-depth",
+		ExternalMetricTargetAnnotationKey:     "10",
+		RequestConcurrencyTargetAnnotationKey: "5",
+	}), 1 /* minReplicas */)
+
+	var sawExternal, sawObject bool
+	for _, s := range specs {
+		switch s.Type {
+		case autoscalingv2beta2.ExternalMetricSourceType:
+			sawExternal = true
+			if s.External.Metric.Name != "queue-depth" {
+				t.Errorf("external metric name = %q, want %q", s.External.Metric.Name, "queue-depth")
+			}
+		case autoscalingv2beta2.ObjectMetricSourceType:
+			sawObject = true
+			if s.Object.Metric.Name != requestConcurrencyMetricName {
+				t.Errorf("object metric name = %q, want %q", s.Object.Metric.Name, requestConcurrencyMetricName)
+			}
+		}
+	}
+	if !sawExternal {
+		t.Error("expected an External MetricSpec, got none")
+	}
+	if !sawObject {
+		t.Error("expected an Object MetricSpec, got none")
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"time"
+
+	pav1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+)
+
+const (
+	// IdleSinceAnnotationKey records, as an RFC3339 timestamp, when the
+	// hpa-class Autoscaler first observed its scale target at zero
+	// replicas. Unlike the other annotations in this package it's not
+	// user-facing: the Autoscaler stamps and clears it itself as
+	// bookkeeping for how long the target has been idle.
+	IdleSinceAnnotationKey = "autoscaling.knative.dev/hpaIdleSince"
+
+	// LastPinnedAnnotationKey is bumped, to the current time, by the
+	// activator whenever it proxies a request on behalf of a PA that's
+	// scaled to zero. The hpa-class Autoscaler watches for a value newer
+	// than IdleSinceAnnotationKey as its signal to scale back up.
+	LastPinnedAnnotationKey = "autoscaling.knative.dev/lastPinned"
+)
+
+// FormatIdleSince formats t the way IdleSinceAnnotationKey and
+// LastPinnedAnnotationKey expect their values.
+func FormatIdleSince(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// IdleSince reports the time recorded by IdleSinceAnnotationKey, if any.
+func IdleSince(pa *pav1alpha1.PodAutoscaler) (time.Time, bool) {
+	return parseTimeAnnotation(pa, IdleSinceAnnotationKey)
+}
+
+// LastPinned reports the time recorded by LastPinnedAnnotationKey, if any.
+func LastPinned(pa *pav1alpha1.PodAutoscaler) (time.Time, bool) {
+	return parseTimeAnnotation(pa, LastPinnedAnnotationKey)
+}
+
+func parseTimeAnnotation(pa *pav1alpha1.PodAutoscaler, key string) (time.Time, bool) {
+	v, ok := pa.Annotations[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
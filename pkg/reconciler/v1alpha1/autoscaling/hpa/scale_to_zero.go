@@ -0,0 +1,136 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hpa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/knative/pkg/logging"
+	pav1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+	nv1alpha1 "github.com/knative/serving/pkg/apis/networking/v1alpha1"
+	"github.com/knative/serving/pkg/reconciler/v1alpha1/autoscaling/hpa/config"
+	"github.com/knative/serving/pkg/reconciler/v1alpha1/autoscaling/hpa/resources"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// scaleToZeroState figures out, for a v2beta2-backed PA whose scale
+// target currently has replicas pods, whether the SKS should be serving
+// directly or proxying through the activator, and what MinReplicas the
+// HPA should be pinned to as a result. As a side effect it stamps or
+// clears IdleSinceAnnotationKey, the bookkeeping annotation used to track
+// how long the target has sat at zero replicas.
+//
+// It reads the current time off of r.clock rather than calling time.Now
+// directly so that the idle/grace-period state machine can be driven by
+// a fake clock in tests.
+func (r *hpaAutoscaler) scaleToZeroState(ctx context.Context, pa *pav1alpha1.PodAutoscaler, replicas int32) (nv1alpha1.ServerlessServiceOperationMode, int32, error) {
+	activeMin, _ := resources.ScaleBounds(pa)
+
+	if replicas > 0 {
+		if err := r.clearIdleSince(ctx, pa); err != nil {
+			return "", 0, err
+		}
+		pa.Status.MarkActive()
+		return nv1alpha1.SKSOperationModeServe, activeMin, nil
+	}
+
+	idleSince, hasIdleSince := resources.IdleSince(pa)
+	if !hasIdleSince {
+		if err := r.stampIdleSince(ctx, pa); err != nil {
+			return "", 0, err
+		}
+		pa.Status.MarkActivating("Queued", "Waiting to confirm the target has no pending traffic before scaling to zero.")
+		return nv1alpha1.SKSOperationModeServe, activeMin, nil
+	}
+
+	if pinned, ok := resources.LastPinned(pa); ok && pinned.After(idleSince) {
+		// The activator has seen traffic more recently than we went
+		// idle; that's our signal to wake back up.
+		if err := r.clearIdleSince(ctx, pa); err != nil {
+			return "", 0, err
+		}
+		pa.Status.MarkActivating("Queued", "Traffic observed by the activator; scaling back up from zero.")
+		return nv1alpha1.SKSOperationModeServe, activeMin, nil
+	}
+
+	if r.clock.Now().Sub(idleSince) < config.FromContext(ctx).ScaleToZeroGracePeriod {
+		pa.Status.MarkActivating("Queued", "Waiting for the scale-to-zero grace period to elapse.")
+		return nv1alpha1.SKSOperationModeServe, activeMin, nil
+	}
+
+	pa.Status.MarkInactive("NoTraffic", "The target is scaled to zero; the activator is proxying requests.")
+	return nv1alpha1.SKSOperationModeProxy, 0, nil
+}
+
+// stampIdleSince records the current time under IdleSinceAnnotationKey.
+func (r *hpaAutoscaler) stampIdleSince(ctx context.Context, pa *pav1alpha1.PodAutoscaler) error {
+	return r.patchIdleSince(ctx, pa, resources.FormatIdleSince(r.clock.Now()))
+}
+
+// clearIdleSince removes IdleSinceAnnotationKey, if present.
+func (r *hpaAutoscaler) clearIdleSince(ctx context.Context, pa *pav1alpha1.PodAutoscaler) error {
+	if _, ok := pa.Annotations[resources.IdleSinceAnnotationKey]; !ok {
+		return nil
+	}
+	return r.patchIdleSince(ctx, pa, "")
+}
+
+// patchIdleSince sets (or, given an empty value, clears) the
+// IdleSinceAnnotationKey bookkeeping annotation via a JSON merge patch of
+// just that one annotation. This is metadata, not status, so unlike the
+// rest of the Autoscaler's changes to pa it's persisted here directly
+// instead of through the Reconciler's normal UpdateStatus path. A merge
+// patch -- rather than a read-modify-write Update -- doesn't require
+// (or touch) pa's ResourceVersion, so it can't race the outer
+// Reconciler's later UpdateStatus call on the same object; it also
+// updates the in-memory pa so the rest of this reconciliation pass sees
+// the new value right away.
+func (r *hpaAutoscaler) patchIdleSince(ctx context.Context, pa *pav1alpha1.PodAutoscaler, value string) error {
+	logger := logging.FromContext(ctx)
+
+	var encodedValue []byte
+	if value == "" {
+		encodedValue = []byte("null")
+	} else {
+		var err error
+		if encodedValue, err = json.Marshal(value); err != nil {
+			return err
+		}
+	}
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:%s}}}`, resources.IdleSinceAnnotationKey, encodedValue))
+
+	updated, err := r.ServingClientSet.AutoscalingV1alpha1().PodAutoscalers(pa.Namespace).Patch(pa.Name, types.MergePatchType, patch)
+	if err != nil {
+		logger.Errorf("Error patching PA %q idle-since annotation: %v", pa.Name, err)
+		return err
+	}
+
+	if value == "" {
+		delete(pa.Annotations, resources.IdleSinceAnnotationKey)
+	} else {
+		if pa.Annotations == nil {
+			pa.Annotations = map[string]string{}
+		}
+		pa.Annotations[resources.IdleSinceAnnotationKey] = value
+	}
+	pa.ResourceVersion = updated.ResourceVersion
+	return nil
+}
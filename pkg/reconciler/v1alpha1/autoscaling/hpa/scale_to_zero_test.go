@@ -0,0 +1,171 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hpa
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	pav1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+	nv1alpha1 "github.com/knative/serving/pkg/apis/networking/v1alpha1"
+	fakeservingclientset "github.com/knative/serving/pkg/client/clientset/versioned/fake"
+	"github.com/knative/serving/pkg/reconciler"
+	"github.com/knative/serving/pkg/reconciler/v1alpha1/autoscaling/hpa/config"
+	"github.com/knative/serving/pkg/reconciler/v1alpha1/autoscaling/hpa/resources"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+const testGracePeriod = 30 * time.Second
+
+func newTestPA(annotations map[string]string) *pav1alpha1.PodAutoscaler {
+	return &pav1alpha1.PodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "my-pa",
+			Namespace:   "default",
+			Annotations: annotations,
+		},
+	}
+}
+
+// newTestAutoscaler wires up an hpaAutoscaler whose clock is pinned to now
+// and whose ServingClientSet is a fake seeded with pa, so patchIdleSince's
+// merge patch has something to land on.
+func newTestAutoscaler(pa *pav1alpha1.PodAutoscaler, now time.Time) (*hpaAutoscaler, context.Context) {
+	base := reconciler.NewBase(reconciler.Options{
+		ServingClientSet: fakeservingclientset.NewSimpleClientset(pa),
+		Logger:           zap.NewNop().Sugar(),
+	}, "test-hpa-class-podautoscaler-controller")
+
+	r := &hpaAutoscaler{
+		Base:  base,
+		clock: clock.NewFakeClock(now),
+	}
+	ctx := config.ToContext(context.Background(), &config.Config{
+		UseHPAV2:              true,
+		ScaleToZeroGracePeriod: testGracePeriod,
+	})
+	return r, ctx
+}
+
+func TestScaleToZeroStateActiveClearsIdleSince(t *testing.T) {
+	now := time.Now()
+	pa := newTestPA(map[string]string{
+		resources.IdleSinceAnnotationKey: resources.FormatIdleSince(now.Add(-time.Minute)),
+	})
+	r, ctx := newTestAutoscaler(pa, now)
+
+	mode, min, err := r.scaleToZeroState(ctx, pa, 1 /* replicas */)
+	if err != nil {
+		t.Fatalf("scaleToZeroState() returned error: %v", err)
+	}
+	if mode != nv1alpha1.SKSOperationModeServe {
+		t.Errorf("mode = %v, want Serve", mode)
+	}
+	if min != 1 {
+		t.Errorf("minReplicas = %d, want 1", min)
+	}
+	if _, ok := resources.IdleSince(pa); ok {
+		t.Error("IdleSinceAnnotationKey still set after going active")
+	}
+}
+
+func TestScaleToZeroStateFirstIdleObservationStampsTime(t *testing.T) {
+	now := time.Now()
+	pa := newTestPA(nil)
+	r, ctx := newTestAutoscaler(pa, now)
+
+	mode, _, err := r.scaleToZeroState(ctx, pa, 0 /* replicas */)
+	if err != nil {
+		t.Fatalf("scaleToZeroState() returned error: %v", err)
+	}
+	if mode != nv1alpha1.SKSOperationModeServe {
+		t.Errorf("mode = %v, want Serve while waiting out the grace period", mode)
+	}
+	idleSince, ok := resources.IdleSince(pa)
+	if !ok {
+		t.Fatal("expected IdleSinceAnnotationKey to be stamped")
+	}
+	if !idleSince.Equal(now.Truncate(time.Second)) {
+		t.Errorf("IdleSince = %v, want %v", idleSince, now)
+	}
+}
+
+func TestScaleToZeroStateLastPinnedWakesUp(t *testing.T) {
+	now := time.Now()
+	idleSince := now.Add(-time.Minute)
+	pa := newTestPA(map[string]string{
+		resources.IdleSinceAnnotationKey:  resources.FormatIdleSince(idleSince),
+		resources.LastPinnedAnnotationKey: resources.FormatIdleSince(now.Add(-time.Second)),
+	})
+	r, ctx := newTestAutoscaler(pa, now)
+
+	mode, _, err := r.scaleToZeroState(ctx, pa, 0 /* replicas */)
+	if err != nil {
+		t.Fatalf("scaleToZeroState() returned error: %v", err)
+	}
+	if mode != nv1alpha1.SKSOperationModeServe {
+		t.Errorf("mode = %v, want Serve after a more recent pin", mode)
+	}
+	if _, ok := resources.IdleSince(pa); ok {
+		t.Error("IdleSinceAnnotationKey still set after waking up")
+	}
+}
+
+func TestScaleToZeroStateGraceElapsedScalesToZero(t *testing.T) {
+	now := time.Now()
+	idleSince := now.Add(-2 * testGracePeriod)
+	pa := newTestPA(map[string]string{
+		resources.IdleSinceAnnotationKey: resources.FormatIdleSince(idleSince),
+	})
+	r, ctx := newTestAutoscaler(pa, now)
+
+	mode, min, err := r.scaleToZeroState(ctx, pa, 0 /* replicas */)
+	if err != nil {
+		t.Fatalf("scaleToZeroState() returned error: %v", err)
+	}
+	if mode != nv1alpha1.SKSOperationModeProxy {
+		t.Errorf("mode = %v, want Proxy once the grace period has elapsed", mode)
+	}
+	if min != 0 {
+		t.Errorf("minReplicas = %d, want 0", min)
+	}
+}
+
+func TestScaleToZeroStateWithinGracePeriodKeepsServing(t *testing.T) {
+	now := time.Now()
+	idleSince := now.Add(-testGracePeriod / 2)
+	pa := newTestPA(map[string]string{
+		resources.IdleSinceAnnotationKey: resources.FormatIdleSince(idleSince),
+	})
+	r, ctx := newTestAutoscaler(pa, now)
+
+	mode, min, err := r.scaleToZeroState(ctx, pa, 0 /* replicas */)
+	if err != nil {
+		t.Fatalf("scaleToZeroState() returned error: %v", err)
+	}
+	if mode != nv1alpha1.SKSOperationModeServe {
+		t.Errorf("mode = %v, want Serve mid grace-period", mode)
+	}
+	if min != 1 {
+		t.Errorf("minReplicas = %d, want 1 (still serving)", min)
+	}
+}
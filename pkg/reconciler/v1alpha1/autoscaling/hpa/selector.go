@@ -0,0 +1,59 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hpa
+
+import (
+	"github.com/knative/pkg/apis"
+	pav1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+
+	autoscalingapi "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/scale"
+)
+
+// getSelector returns the label selector of the Deployment (or other
+// scalable resource) backing pa, read off of its Scale subresource. Both
+// the hpa and external autoscalers need this to keep the SKS pointed at
+// the right pods, so it's shared rather than duplicated per backend.
+func getSelector(scaleClientSet scale.ScalesGetter, pa *pav1alpha1.PodAutoscaler) (map[string]string, error) {
+	s, err := getScaleResource(scaleClientSet, pa)
+	if err != nil {
+		return nil, err
+	}
+	return labels.ConvertSelectorToLabelsMap(s.Status.Selector)
+}
+
+// getScaleResource returns the current scale resource for the PA.
+func getScaleResource(scaleClientSet scale.ScalesGetter, pa *pav1alpha1.PodAutoscaler) (*autoscalingapi.Scale, error) {
+	resource, resourceName, err := scaleResourceArgs(pa)
+	if err != nil {
+		return nil, err
+	}
+	// Identify the current scale.
+	return scaleClientSet.Scales(pa.Namespace).Get(*resource, resourceName)
+}
+
+// scaleResourceArgs returns GroupResource and the resource name, from the PA resource.
+func scaleResourceArgs(pa *pav1alpha1.PodAutoscaler) (*schema.GroupResource, string, error) {
+	gv, err := schema.ParseGroupVersion(pa.Spec.ScaleTargetRef.APIVersion)
+	if err != nil {
+		return nil, "", err
+	}
+	resource := apis.KindToResource(gv.WithKind(pa.Spec.ScaleTargetRef.Kind)).GroupResource()
+	return &resource, pa.Spec.ScaleTargetRef.Name, nil
+}